@@ -0,0 +1,388 @@
+// Package gateway fans out a uof.Message stream to WebSocket clients, so
+// non-Go services can consume the normalized UOF stream without
+// reimplementing AMQP, XML unmarshalling and Betradar recovery themselves.
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/minus5/go-uof-sdk"
+	"github.com/minus5/go-uof-sdk/history"
+	"github.com/minus5/go-uof-sdk/pipe"
+)
+
+// OverflowPolicy decides what happens to a client connection that can't
+// keep up with the stream.
+type OverflowPolicy int
+
+const (
+	// DropOldest discards the oldest buffered frame to make room for the
+	// new one; the client sees gaps but stays connected.
+	DropOldest OverflowPolicy = iota
+	// Disconnect closes the connection once its buffer is full.
+	Disconnect
+)
+
+const (
+	defaultBufferSize   = 1024
+	defaultPingInterval = 30 * time.Second
+	defaultWriteWait    = 10 * time.Second
+)
+
+type config struct {
+	upgrader     websocket.Upgrader
+	bufferSize   int
+	overflow     OverflowPolicy
+	pingInterval time.Duration
+	history      history.Store
+	binary       bool
+}
+
+// Option configures Serve.
+type Option func(*config)
+
+// WithBufferSize sets the per-client outbound ring buffer size. Defaults
+// to 1024 frames.
+func WithBufferSize(n int) Option {
+	return func(c *config) { c.bufferSize = n }
+}
+
+// WithOverflow sets the policy applied once a client's buffer is full.
+// Defaults to DropOldest.
+func WithOverflow(p OverflowPolicy) Option {
+	return func(c *config) { c.overflow = p }
+}
+
+// WithPingInterval sets how often an idle connection is pinged. Defaults
+// to 30s.
+func WithPingInterval(d time.Duration) Option {
+	return func(c *config) { c.pingInterval = d }
+}
+
+// WithHistory lets a subscribing client resume from a timestamp: Serve
+// replays store.All results until it catches up to the live stream.
+// Without it, from_ts in a subscribe frame is ignored and clients only see
+// messages from the moment they connect.
+func WithHistory(store history.Store) Option {
+	return func(c *config) { c.history = store }
+}
+
+// WithBinaryFraming switches the wire format from one JSON object per
+// message to uof.Message.Marshal's header-JSON + raw-XML layout, so Go
+// clients can uof.Message.Unmarshal frames directly without re-parsing.
+func WithBinaryFraming() Option {
+	return func(c *config) { c.binary = true }
+}
+
+// subscribeFrame is the first frame a client must send after connecting.
+type subscribeFrame struct {
+	Filter string `json:"filter"`
+	FromTS int64  `json:"from_ts"`
+}
+
+// ClientStats are the per-connection metrics exposed for monitoring.
+type ClientStats struct {
+	Lag   int // frames currently buffered, not yet written
+	Drops int // frames dropped because of overflow
+}
+
+type client struct {
+	conn    *websocket.Conn
+	send    chan []byte
+	matcher uof.Matcher
+
+	mu        sync.Mutex
+	drops     int
+	buffering bool     // true while a history replay is in flight
+	liveBuf   [][]byte // live frames held back until the replay drains
+}
+
+// Serve starts a WebSocket server on addr and returns a Gateway (for
+// Stats) plus the pipe.StageHandler that forwards every message passing
+// through the pipe to it; it also passes each message unchanged to out, so
+// the handler can sit anywhere in the stage chain without affecting the
+// rest of the pipeline.
+//
+// A client connects, sends one subscribeFrame, and from then on receives
+// every message matching Filter (the uof.ParseQuery expression language;
+// empty matches everything) as either a JSON object or, with
+// WithBinaryFraming, the Marshal/Unmarshal header-JSON+raw-XML layout.
+func Serve(ctx context.Context, addr string, opts ...Option) (*Gateway, pipe.StageHandler) {
+	cfg := config{
+		bufferSize:   defaultBufferSize,
+		pingInterval: defaultPingInterval,
+		overflow:     DropOldest,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	g := &Gateway{cfg: cfg, clients: make(map[*client]struct{})}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", g.handleWS)
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("gateway: listen on %s: %s", addr, err)
+		}
+	}()
+
+	return g, func(in <-chan *uof.Message, out chan<- *uof.Message, errc chan<- error) {
+		for m := range in {
+			g.broadcast(m)
+			out <- m
+		}
+	}
+}
+
+// Gateway holds the set of connected WebSocket clients and fans out
+// messages to them. Returned by Serve so callers can reach Stats; the
+// pipe.StageHandler Serve also returns is what actually feeds it messages.
+type Gateway struct {
+	cfg config
+
+	mu      sync.Mutex
+	clients map[*client]struct{}
+}
+
+// Stats returns a snapshot of Lag/Drops for every client currently
+// connected.
+func (g *Gateway) Stats() []ClientStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	stats := make([]ClientStats, 0, len(g.clients))
+	for c := range g.clients {
+		stats = append(stats, c.Stats())
+	}
+	return stats
+}
+
+func (g *Gateway) addClient(c *client) {
+	g.mu.Lock()
+	g.clients[c] = struct{}{}
+	g.mu.Unlock()
+}
+
+func (g *Gateway) removeClient(c *client) {
+	g.mu.Lock()
+	delete(g.clients, c)
+	g.mu.Unlock()
+	close(c.send)
+}
+
+func (g *Gateway) broadcast(m *uof.Message) {
+	frame := g.frame(m)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for c := range g.clients {
+		if c.matcher != nil && !c.matcher(m) {
+			continue
+		}
+		c.enqueue(frame, g.cfg.overflow)
+	}
+}
+
+func (g *Gateway) frame(m *uof.Message) []byte {
+	if g.cfg.binary {
+		return m.Marshal()
+	}
+	buf, _ := json.Marshal(m)
+	return buf
+}
+
+// enqueue delivers frame to c, unless a replay is in progress (see
+// replayThenGoLive), in which case it's held back in liveBuf so it can't
+// race with - or be duplicated by - the replay's own writes to c.send.
+func (c *client) enqueue(frame []byte, overflow OverflowPolicy) {
+	c.mu.Lock()
+	if c.buffering {
+		c.bufferLive(frame, overflow)
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	c.enqueueDirect(frame, overflow)
+}
+
+// bufferLive appends frame to liveBuf, applying overflow once it's as full
+// as c.send's own capacity. Caller must hold c.mu.
+func (c *client) bufferLive(frame []byte, overflow OverflowPolicy) {
+	if len(c.liveBuf) < cap(c.send) {
+		c.liveBuf = append(c.liveBuf, frame)
+		return
+	}
+	switch overflow {
+	case DropOldest:
+		c.liveBuf = append(c.liveBuf[1:], frame)
+		c.drops++
+	case Disconnect:
+		go c.conn.Close()
+	}
+}
+
+// enqueueDirect delivers frame straight to c.send, bypassing liveBuf. Used
+// both for ordinary (non-replaying) clients and for the replay itself.
+func (c *client) enqueueDirect(frame []byte, overflow OverflowPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enqueueDirectLocked(frame, overflow)
+}
+
+// enqueueDirectLocked is enqueueDirect's body for a caller that already
+// holds c.mu - replayThenGoLive drains liveBuf this way so the drain and
+// the flip of buffering back to false happen as one atomic step a
+// concurrent broadcast can't interleave with.
+func (c *client) enqueueDirectLocked(frame []byte, overflow OverflowPolicy) {
+	select {
+	case c.send <- frame:
+		return
+	default:
+	}
+	switch overflow {
+	case DropOldest:
+		select {
+		case <-c.send:
+			c.drops++
+		default:
+		}
+		select {
+		case c.send <- frame:
+		default:
+		}
+	case Disconnect:
+		go c.conn.Close()
+	}
+}
+
+// Stats returns the client's current lag/drop metrics.
+func (c *client) Stats() ClientStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ClientStats{Lag: len(c.send), Drops: c.drops}
+}
+
+func (g *Gateway) handleWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := g.cfg.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	var sub subscribeFrame
+	if err := conn.ReadJSON(&sub); err != nil {
+		conn.Close()
+		return
+	}
+
+	c := &client{conn: conn, send: make(chan []byte, g.cfg.bufferSize)}
+	if sub.Filter != "" {
+		q, err := uof.ParseQuery(sub.Filter)
+		if err != nil {
+			conn.WriteJSON(map[string]string{"error": err.Error()})
+			conn.Close()
+			return
+		}
+		c.matcher = q.Matcher()
+	}
+
+	if g.cfg.history != nil && sub.FromTS > 0 {
+		g.replayThenGoLive(c, sub)
+	} else {
+		g.addClient(c)
+	}
+
+	go g.readPump(c)
+	g.writePump(c)
+}
+
+// replayThenGoLive pushes every history message in [sub.FromTS, now] into
+// the client's send queue, then lets it join the live broadcast, without
+// the two ever racing on c.send.
+//
+// It registers c before querying history (so no live message is missed) but
+// with c.buffering set, which redirects broadcast()'s writes into liveBuf
+// instead of c.send; only once it has drained liveBuf into c.send does it
+// flip buffering off, both done under one c.mu hold so a concurrent
+// broadcast can't see buffering==false and write to c.send before the drain
+// finishes. A message landing in the last instant of the replay window can
+// still show up in both the replay and liveBuf - an occasional duplicate
+// right at the resume boundary, never a gap or reordering.
+func (g *Gateway) replayThenGoLive(c *client, sub subscribeFrame) {
+	c.mu.Lock()
+	c.buffering = true
+	c.mu.Unlock()
+	g.addClient(c)
+
+	from := time.Unix(0, sub.FromTS*int64(time.Millisecond))
+	to := time.Now()
+	msgs, err := g.cfg.history.All(from, to)
+	if err == nil {
+		for _, m := range msgs {
+			if c.matcher != nil && !c.matcher(m) {
+				continue
+			}
+			c.enqueueDirect(g.frame(m), g.cfg.overflow)
+		}
+	}
+
+	c.mu.Lock()
+	for _, frame := range c.liveBuf {
+		c.enqueueDirectLocked(frame, g.cfg.overflow)
+	}
+	c.liveBuf = nil
+	c.buffering = false
+	c.mu.Unlock()
+}
+
+func (g *Gateway) readPump(c *client) {
+	defer g.removeClient(c)
+	c.conn.SetReadDeadline(time.Now().Add(2 * g.cfg.pingInterval))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(2 * g.cfg.pingInterval))
+		return nil
+	})
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (g *Gateway) writePump(c *client) {
+	ticker := time.NewTicker(g.cfg.pingInterval)
+	defer ticker.Stop()
+	defer c.conn.Close()
+	for {
+		select {
+		case frame, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(defaultWriteWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			msgType := websocket.TextMessage
+			if g.cfg.binary {
+				msgType = websocket.BinaryMessage
+			}
+			if err := c.conn.WriteMessage(msgType, frame); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(defaultWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestClientBufferLiveFlushesAfterReplayInOrder guards the ordering
+// replayThenGoLive promises: while buffering is set, enqueue must redirect
+// live frames into liveBuf instead of c.send, and once buffering flips off
+// the buffered live frames must land after whatever was already written
+// directly (the replay), never interleaved or reordered.
+func TestClientBufferLiveFlushesAfterReplayInOrder(t *testing.T) {
+	c := &client{send: make(chan []byte, 10)}
+
+	c.mu.Lock()
+	c.buffering = true
+	c.mu.Unlock()
+
+	// Live frames arriving mid-replay must be held back, not written yet.
+	c.enqueue([]byte("live-1"), DropOldest)
+	c.enqueue([]byte("live-2"), DropOldest)
+
+	// The replay itself writes straight through enqueueDirect, same as
+	// replayThenGoLive does.
+	c.enqueueDirect([]byte("replay-1"), DropOldest)
+	c.enqueueDirect([]byte("replay-2"), DropOldest)
+
+	c.mu.Lock()
+	for _, frame := range c.liveBuf {
+		c.enqueueDirectLocked(frame, DropOldest)
+	}
+	c.liveBuf = nil
+	c.buffering = false
+	c.mu.Unlock()
+
+	close(c.send)
+	var got []string
+	for frame := range c.send {
+		got = append(got, string(frame))
+	}
+	assert.Equal(t, []string{"replay-1", "replay-2", "live-1", "live-2"}, got)
+}
+
+// TestClientEnqueueBlocksOnLockedDrain guards the fix for the race
+// replayThenGoLive used to have: a concurrent enqueue (what broadcast calls)
+// must block while a caller holds c.mu draining liveBuf, so it can never
+// land in c.send ahead of the buffered frames being flushed.
+func TestClientEnqueueBlocksOnLockedDrain(t *testing.T) {
+	c := &client{send: make(chan []byte, 10)}
+
+	c.mu.Lock()
+	done := make(chan struct{})
+	go func() {
+		c.enqueue([]byte("live"), DropOldest)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("enqueue returned while the drain still held c.mu")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	c.enqueueDirectLocked([]byte("buffered"), DropOldest)
+	c.mu.Unlock()
+	<-done
+
+	close(c.send)
+	var got []string
+	for frame := range c.send {
+		got = append(got, string(frame))
+	}
+	assert.Equal(t, []string{"buffered", "live"}, got)
+}
+
+// TestClientBufferLiveOverflowDropsOldest guards bufferLive's own overflow
+// handling: once liveBuf is as full as c.send's capacity, DropOldest must
+// evict the oldest held-back frame (not the new one) and count a drop.
+func TestClientBufferLiveOverflowDropsOldest(t *testing.T) {
+	c := &client{send: make(chan []byte, 2), buffering: true}
+
+	c.enqueue([]byte("live-1"), DropOldest)
+	c.enqueue([]byte("live-2"), DropOldest)
+	c.enqueue([]byte("live-3"), DropOldest)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	assert.Equal(t, [][]byte{[]byte("live-2"), []byte("live-3")}, c.liveBuf)
+	assert.Equal(t, 1, c.drops)
+}
+
+// TestGatewayDisconnectsSlowClientOnOverflow guards the Disconnect overflow
+// policy end to end: a client that never reads must be dropped, not left
+// to block the broadcaster or grow its buffer unbounded.
+func TestGatewayDisconnectsSlowClientOnOverflow(t *testing.T) {
+	g := &Gateway{
+		cfg:     config{bufferSize: 1, overflow: Disconnect, pingInterval: time.Second},
+		clients: make(map[*client]struct{}),
+	}
+	ts := httptest.NewServer(http.HandlerFunc(g.handleWS))
+	defer ts.Close()
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Nil(t, conn.WriteJSON(subscribeFrame{}))
+
+	// Give handleWS a moment to register the client before broadcasting -
+	// the test deliberately never reads, so the send buffer overflows and
+	// the connection is closed from the server side.
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		g.broadcast(nil)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = conn.ReadMessage()
+	assert.NotNil(t, err, "server should have closed the connection once its buffer overflowed")
+}
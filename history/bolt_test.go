@@ -0,0 +1,132 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/minus5/go-uof-sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestStore(t *testing.T) *BoltStore {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "history.db")
+	s, err := Open(path)
+	assert.Nil(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestBoltStorePutAndBetween(t *testing.T) {
+	s := openTestStore(t)
+
+	m1 := &uof.Message{Header: uof.Header{Type: uof.MessageTypeOddsChange, EventID: 42, ReceivedAt: 100}}
+	m2 := &uof.Message{Header: uof.Header{Type: uof.MessageTypeBetStop, EventID: 42, ReceivedAt: 200}}
+	m3 := &uof.Message{Header: uof.Header{Type: uof.MessageTypeOddsChange, EventID: 99, ReceivedAt: 150}}
+	assert.Nil(t, s.Put(0, m1))
+	assert.Nil(t, s.Put(0, m2))
+	assert.Nil(t, s.Put(0, m3))
+
+	msgs, err := s.Between(42, time.UnixMilli(0), time.UnixMilli(1000))
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, 100, msgs[0].ReceivedAt)
+	assert.Equal(t, 200, msgs[1].ReceivedAt)
+
+	oc, err := s.Between(42, time.UnixMilli(0), time.UnixMilli(1000), uof.MessageTypeOddsChange)
+	assert.Nil(t, err)
+	assert.Len(t, oc, 1)
+	assert.Equal(t, 100, oc[0].ReceivedAt)
+}
+
+func TestBoltStorePutAndRecovery(t *testing.T) {
+	s := openTestStore(t)
+
+	m := &uof.Message{Header: uof.Header{Type: uof.MessageTypeOddsChange, EventID: 1, ReceivedAt: 500}}
+	assert.Nil(t, s.Put(7, m))
+
+	msgs, err := s.Recovery(7, time.UnixMilli(0), time.UnixMilli(1000))
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, 500, msgs[0].ReceivedAt)
+
+	none, err := s.Recovery(3, time.UnixMilli(0), time.UnixMilli(1000))
+	assert.Nil(t, err)
+	assert.Len(t, none, 0)
+}
+
+// TestBoltStoreCoversOnlyTrustsOwnProducer guards the false-positive bug
+// fixed in a4778d7: Seek(prefix) lands on the next key >= prefix, which
+// for a producer with no data at all is some *other* producer's oldest
+// entry, not "nothing" - Covers must not mistake that for its own data.
+func TestBoltStoreCoversOnlyTrustsOwnProducer(t *testing.T) {
+	s := openTestStore(t)
+
+	m := &uof.Message{Header: uof.Header{Type: uof.MessageTypeOddsChange, EventID: 1, ReceivedAt: 1000}}
+	assert.Nil(t, s.Put(5, m))
+
+	covered, err := s.Covers(5, time.UnixMilli(1500), time.UnixMilli(2000))
+	assert.Nil(t, err)
+	assert.True(t, covered, "producer 5 has data from 1000 onward")
+
+	notCovered, err := s.Covers(5, time.UnixMilli(500), time.UnixMilli(2000))
+	assert.Nil(t, err)
+	assert.False(t, notCovered, "producer 5 has no data before 1000")
+
+	neverSeen, err := s.Covers(2, time.UnixMilli(1500), time.UnixMilli(2000))
+	assert.Nil(t, err)
+	assert.False(t, neverSeen, "producer 2 has never been stored - must not borrow producer 5's entry")
+}
+
+func TestBoltStoreRetainDropsOlderThanMaxAge(t *testing.T) {
+	s := openTestStore(t)
+
+	now := time.Now()
+	old := &uof.Message{Header: uof.Header{Type: uof.MessageTypeOddsChange, EventID: 1, ReceivedAt: int(now.Add(-2 * time.Hour).UnixNano() / 1e6)}}
+	fresh := &uof.Message{Header: uof.Header{Type: uof.MessageTypeOddsChange, EventID: 1, ReceivedAt: int(now.UnixNano() / 1e6)}}
+	assert.Nil(t, s.Put(0, old))
+	assert.Nil(t, s.Put(0, fresh))
+
+	assert.Nil(t, s.Retain(time.Hour, 0))
+
+	msgs, err := s.Between(1, now.Add(-3*time.Hour), now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, fresh.ReceivedAt, msgs[0].ReceivedAt)
+}
+
+// TestBoltStoreRetainMaxBytesEvictsOldestAndShrinksFile guards Retain's
+// byte cap: bbolt never shrinks its file on its own, so without the
+// compact step this would delete entries but leave the file the same
+// size.
+func TestBoltStoreRetainMaxBytesEvictsOldestAndShrinksFile(t *testing.T) {
+	s := openTestStore(t)
+
+	const n = 300
+	for i := 1; i <= n; i++ {
+		m := &uof.Message{Header: uof.Header{Type: uof.MessageTypeAlive, EventID: i, ReceivedAt: i}}
+		assert.Nil(t, s.Put(0, m))
+	}
+
+	path := s.db.Path()
+	before, err := os.Stat(path)
+	assert.Nil(t, err)
+
+	// maxAge huge enough that it alone would not evict anything (every
+	// ReceivedAt above is a tiny int, already "older" than any realistic
+	// cutoff) - isolates this test to the byte-cap path.
+	assert.Nil(t, s.Retain(100*365*24*time.Hour, before.Size()/2))
+
+	after, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.True(t, after.Size() < before.Size(), "compact should shrink the file once entries are evicted")
+
+	all, err := s.All(time.UnixMilli(0), time.UnixMilli(n+1))
+	assert.Nil(t, err)
+	assert.True(t, len(all) < n, "byte cap should have evicted the oldest entries")
+	for _, m := range all {
+		assert.True(t, m.ReceivedAt > n/2, "surviving entries should be the newest ones")
+	}
+}
@@ -0,0 +1,52 @@
+// Package history durably records uof.Message traffic so operators can
+// replay it after a crash or query it offline, without re-running Betradar
+// recovery for every producer.
+package history
+
+import (
+	"time"
+
+	"github.com/minus5/go-uof-sdk"
+)
+
+// Store persists messages flowing through the pipe and answers range
+// queries over them.
+//
+// Implementations must be safe for concurrent use: Put is called from the
+// pipe goroutine while Between/Recovery may be called concurrently by
+// downstream consumers or by the SDK's recovery path.
+type Store interface {
+	// Put durably records m, indexed both by (m.EventID, m.ReceivedAt) and
+	// by (producer, m.ReceivedAt). producer is the Betradar producer ID the
+	// message arrived on; pass 0 if unknown (m.Header currently has no
+	// Producer field, so callers that don't track it separately fall back
+	// to event-only indexing and Recovery will not find those messages).
+	Put(producer int, m *uof.Message) error
+	// Between returns every stored message for eventID received in
+	// [from, to], optionally restricted to types, ordered by ReceivedAt.
+	Between(eventID int, from, to time.Time, types ...uof.MessageType) ([]*uof.Message, error)
+	// Recovery returns every message stored for producer received in
+	// [from, to], ordered by ReceivedAt. Used to satisfy a recovery window
+	// from disk instead of calling the Betradar recovery API.
+	Recovery(producer int, from, to time.Time) ([]*uof.Message, error)
+	// All returns every stored message received in [from, to] regardless of
+	// event or producer, optionally restricted to types, ordered by
+	// ReceivedAt. Used to replay a client up to the live stream by
+	// timestamp alone.
+	All(from, to time.Time, types ...uof.MessageType) ([]*uof.Message, error)
+	// Covers reports whether the store has a complete, gap-free record for
+	// producer across [from, to]. Stores that can't make that guarantee
+	// (e.g. because Retain may have dropped the tail) should return false.
+	Covers(producer int, from, to time.Time) (bool, error)
+	// Retain enforces the retention policy: messages older than maxAge are
+	// deleted, and once the store exceeds maxBytes the oldest entries are
+	// compacted away first. Safe to call periodically from a background
+	// goroutine.
+	Retain(maxAge time.Duration, maxBytes int64) error
+	// Close releases the underlying resources.
+	Close() error
+}
+
+func timestampRange(from, to time.Time) (int, int) {
+	return int(from.UnixNano() / 1e6), int(to.UnixNano() / 1e6)
+}
@@ -43,6 +43,8 @@ type Message struct {
 	Header `json:",inline"`
 	Raw    []byte `json:"-"`
 	Body   `json:",inline"`
+
+	decoded bool // body already unmarshaled from Raw, see Decode
 }
 
 var uniqTimestamp func() int // ensures unique timestamp value
@@ -73,6 +75,16 @@ func timeToTimestamp(t time.Time) int {
 }
 
 func NewQueueMessage(routingKey string, body []byte) (*Message, error) {
+	return NewQueueMessageWhere(routingKey, body, nil)
+}
+
+// NewQueueMessageWhere is like NewQueueMessage but only decodes the XML
+// body immediately when wantBody is nil or returns true for the parsed
+// Header. Otherwise the raw bytes stay on Message.Raw and are decoded
+// lazily, the first time Decode is called. This lets a subscriber
+// filtering on Header fields alone (see ParseQuery) skip the XML unmarshal
+// for messages it's going to discard anyway.
+func NewQueueMessageWhere(routingKey string, body []byte, wantBody func(*Header) bool) (*Message, error) {
 	r := &Message{
 		Header: Header{ReceivedAt: uniqTimestamp()},
 		Raw:    body,
@@ -80,7 +92,10 @@ func NewQueueMessage(routingKey string, body []byte) (*Message, error) {
 	if err := r.parseRoutingKey(routingKey); err != nil {
 		return nil, err
 	}
-	return r, r.unpack()
+	if wantBody == nil || wantBody(&r.Header) {
+		return r, r.unpack()
+	}
+	return r, nil
 }
 
 func (m *Message) parseRoutingKey(routingKey string) error {
@@ -129,8 +144,16 @@ func (m *Message) parseRoutingKey(routingKey string) error {
 	return nil
 }
 
+// Decode forces the XML body to be unmarshaled if it was deferred by
+// NewQueueMessageWhere, populating the matching Body field (m.OddsChange,
+// m.BetSettlement, ...). Safe to call more than once or when the body was
+// already decoded; it's then a no-op.
+func (m *Message) Decode() error {
+	return m.unpack()
+}
+
 func (m *Message) unpack() error {
-	if m.Raw == nil {
+	if m.Raw == nil || m.decoded {
 		return nil
 	}
 	var err error
@@ -186,6 +209,7 @@ func (m *Message) unpack() error {
 	if err != nil {
 		return Notice("message.unpack", err)
 	}
+	m.decoded = true
 	return nil
 }
 
@@ -229,6 +253,21 @@ func NewConnnectionMessage(status ConnectionStatus) *Message {
 	}
 }
 
+// NewSnapshotCompleteMessage builds the synthetic end-of-recovery marker a
+// consumer normally gets from Betradar once a recovery request drains -
+// used by sdk.RecoveryFromHistory to signal the same thing after replaying
+// a covered window from disk instead of calling the recovery API.
+func NewSnapshotCompleteMessage() *Message {
+	return &Message{
+		Header: Header{
+			Type:       MessageTypeSnapshotComplete,
+			Scope:      MessageScopeSystem,
+			ReceivedAt: uniqTimestamp(),
+		},
+		Body: Body{SnapshotComplete: &SnapshotComplete{}},
+	}
+}
+
 func NewProducersChangeMessage(pc ProducersChange) *Message {
 	return &Message{
 		Header: Header{
@@ -1,6 +1,7 @@
 package uof
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -102,3 +103,43 @@ func TestMessageTypeParse(t *testing.T) {
 	y.Parse("alive")
 	assert.Equal(t, MessageTypeAlive, y)
 }
+
+func TestNewQueueMessageWhereDefersDecode(t *testing.T) {
+	key := "hi.-.live.odds_change.1.sr:match.1234"
+	body := []byte(`<odds_change/>`)
+
+	m, err := NewQueueMessageWhere(key, body, func(h *Header) bool { return false })
+	assert.Nil(t, err)
+	assert.Nil(t, m.OddsChange)
+
+	assert.Nil(t, m.Decode())
+	assert.NotNil(t, m.OddsChange) // backward compat: field populated once decoded
+
+	m2, err := NewQueueMessageWhere(key, body, func(h *Header) bool { return true })
+	assert.Nil(t, err)
+	assert.NotNil(t, m2.OddsChange)
+}
+
+// BenchmarkNewQueueMessageWhere models a realistic mix where ~90% of
+// messages are filtered out on Header alone: lazy decoding should only pay
+// the XML unmarshal cost for the 10% a subscriber actually wants.
+func BenchmarkNewQueueMessageWhere(b *testing.B) {
+	body := []byte(`<odds_change><market id="1"/><market id="2"/></odds_change>`)
+	key := func(i int) string {
+		return fmt.Sprintf("hi.-.live.odds_change.1.sr:match.%d", i)
+	}
+	wantBody := func(h *Header) bool { return h.EventID%10 == 0 } // ~10% want it
+
+	b.Run("eager", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			NewQueueMessage(key(i), body)
+		}
+	})
+	b.Run("lazy", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			NewQueueMessageWhere(key(i), body, wantBody)
+		}
+	})
+}
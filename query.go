@@ -0,0 +1,647 @@
+package uof
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Matcher reports whether a message satisfies a compiled Query.
+//
+// It reads only the strongly typed fields of Header, so evaluating it never
+// triggers XML unmarshalling of the message body.
+type Matcher func(*Message) bool
+
+// Query is a compiled filter expression over Header fields.
+//
+// Build one with ParseQuery and reuse it; parsing and AST walking happen
+// once, matching a message is just calling the compiled Matcher.
+type Query struct {
+	src   string
+	match Matcher
+}
+
+// ParseQuery parses a filter expression and compiles it into a Query.
+//
+// Supported grammar (field names are the lower_snake_case form of the
+// corresponding Header field):
+//
+//	expr       := orExpr
+//	orExpr     := andExpr ("OR" andExpr)*
+//	andExpr    := unary ("AND" unary)*
+//	unary      := "NOT" unary | "(" expr ")" | cmp
+//	cmp        := field "=" value
+//	            | field "!=" value
+//	            | field ("<" | "<=" | ">" | ">=") value
+//	            | field "IN" "(" value ("," value)* ")"
+//	            | field "LIKE" value
+//
+// field is one of: type, scope, priority, lang, sport_id, event_id,
+// event_urn, received_at. LIKE accepts a single "*" glob, e.g.
+// event_urn LIKE 'sr:match:*'.
+//
+// There is no producer field: Header carries no producer ID in this tree
+// (it isn't present on the routing key, and the XML body attribute that
+// does carry it isn't modeled here), so a query can't filter on it yet.
+// Example: `type='odds_change' AND sport_id=1 AND scope IN ('live','prematch') AND priority='hi'`.
+func ParseQuery(expr string) (*Query, error) {
+	p := &queryParser{toks: tokenizeQuery(expr)}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, Notice("query.Parse", err)
+	}
+	if !p.eof() {
+		return nil, Notice("query.Parse", fmt.Errorf("unexpected token %q", p.peek().val))
+	}
+	m, err := node.compile()
+	if err != nil {
+		return nil, Notice("query.Parse", err)
+	}
+	return &Query{src: expr, match: m}, nil
+}
+
+// Match reports whether m satisfies the query.
+func (q *Query) Match(m *Message) bool {
+	return q.match(m)
+}
+
+// Matcher returns the compiled Matcher so callers can use it directly
+// without holding onto the Query value.
+func (q *Query) Matcher() Matcher {
+	return q.match
+}
+
+func (q *Query) String() string {
+	return q.src
+}
+
+// queryNode is one node of the parsed AST.
+type queryNode interface {
+	compile() (Matcher, error)
+}
+
+type andNode struct{ left, right queryNode }
+type orNode struct{ left, right queryNode }
+type notNode struct{ n queryNode }
+
+func (n *andNode) compile() (Matcher, error) {
+	l, err := n.left.compile()
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.compile()
+	if err != nil {
+		return nil, err
+	}
+	return func(m *Message) bool { return l(m) && r(m) }, nil
+}
+
+func (n *orNode) compile() (Matcher, error) {
+	l, err := n.left.compile()
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.compile()
+	if err != nil {
+		return nil, err
+	}
+	return func(m *Message) bool { return l(m) || r(m) }, nil
+}
+
+func (n *notNode) compile() (Matcher, error) {
+	inner, err := n.n.compile()
+	if err != nil {
+		return nil, err
+	}
+	return func(m *Message) bool { return !inner(m) }, nil
+}
+
+type cmpOp int
+
+const (
+	cmpEq cmpOp = iota
+	cmpNeq
+	cmpLt
+	cmpLte
+	cmpGt
+	cmpGte
+	cmpIn
+	cmpLike
+)
+
+type cmpNode struct {
+	field string
+	op    cmpOp
+	args  []string
+}
+
+func (n *cmpNode) compile() (Matcher, error) {
+	switch n.field {
+	case "type":
+		return compileTypeCmp(n.op, n.args)
+	case "scope":
+		return compileScopeCmp(n.op, n.args)
+	case "priority":
+		return compilePriorityCmp(n.op, n.args)
+	case "lang":
+		return compileLangCmp(n.op, n.args)
+	case "sport_id":
+		return compileIntCmp(n.op, n.args, func(m *Message) int { return m.SportID })
+	case "event_id":
+		return compileIntCmp(n.op, n.args, func(m *Message) int { return m.EventID })
+	case "received_at":
+		return compileIntCmp(n.op, n.args, func(m *Message) int { return m.ReceivedAt })
+	case "event_urn":
+		return compileURNCmp(n.op, n.args)
+	default:
+		return nil, fmt.Errorf("unknown field %q", n.field)
+	}
+}
+
+func compileTypeCmp(op cmpOp, args []string) (Matcher, error) {
+	vals := make([]MessageType, 0, len(args))
+	for _, a := range args {
+		var t MessageType
+		t.Parse(a)
+		if t == MessageTypeUnknown {
+			return nil, fmt.Errorf("unknown message type %q", a)
+		}
+		vals = append(vals, t)
+	}
+	get := func(m *Message) MessageType { return m.Type }
+	switch op {
+	case cmpEq:
+		want := vals[0]
+		return func(m *Message) bool { return get(m) == want }, nil
+	case cmpNeq:
+		want := vals[0]
+		return func(m *Message) bool { return get(m) != want }, nil
+	case cmpIn:
+		return func(m *Message) bool {
+			v := get(m)
+			for _, want := range vals {
+				if v == want {
+					return true
+				}
+			}
+			return false
+		}, nil
+	default:
+		return nil, fmt.Errorf("operator not supported for field %q", "type")
+	}
+}
+
+func compileScopeCmp(op cmpOp, args []string) (Matcher, error) {
+	vals := make([]MessageScope, 0, len(args))
+	for _, a := range args {
+		v, err := parseScopeLiteral(a)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	get := func(m *Message) MessageScope { return m.Scope }
+	switch op {
+	case cmpEq:
+		want := vals[0]
+		return func(m *Message) bool { return get(m) == want }, nil
+	case cmpNeq:
+		want := vals[0]
+		return func(m *Message) bool { return get(m) != want }, nil
+	case cmpIn:
+		return func(m *Message) bool {
+			v := get(m)
+			for _, want := range vals {
+				if v == want {
+					return true
+				}
+			}
+			return false
+		}, nil
+	default:
+		return nil, fmt.Errorf("operator not supported for field %q", "scope")
+	}
+}
+
+func compilePriorityCmp(op cmpOp, args []string) (Matcher, error) {
+	vals := make([]MessagePriority, 0, len(args))
+	for _, a := range args {
+		v, err := parsePriorityLiteral(a)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	get := func(m *Message) MessagePriority { return m.Priority }
+	switch op {
+	case cmpEq:
+		want := vals[0]
+		return func(m *Message) bool { return get(m) == want }, nil
+	case cmpNeq:
+		want := vals[0]
+		return func(m *Message) bool { return get(m) != want }, nil
+	case cmpIn:
+		return func(m *Message) bool {
+			v := get(m)
+			for _, want := range vals {
+				if v == want {
+					return true
+				}
+			}
+			return false
+		}, nil
+	default:
+		return nil, fmt.Errorf("operator not supported for field %q", "priority")
+	}
+}
+
+func compileLangCmp(op cmpOp, args []string) (Matcher, error) {
+	vals := make([]Lang, 0, len(args))
+	for _, a := range args {
+		var l Lang
+		l.Parse(a)
+		vals = append(vals, l)
+	}
+	get := func(m *Message) Lang { return m.Lang }
+	switch op {
+	case cmpEq:
+		want := vals[0]
+		return func(m *Message) bool { return get(m) == want }, nil
+	case cmpNeq:
+		want := vals[0]
+		return func(m *Message) bool { return get(m) != want }, nil
+	case cmpIn:
+		return func(m *Message) bool {
+			v := get(m)
+			for _, want := range vals {
+				if v == want {
+					return true
+				}
+			}
+			return false
+		}, nil
+	default:
+		return nil, fmt.Errorf("operator not supported for field %q", "lang")
+	}
+}
+
+func compileIntCmp(op cmpOp, args []string, get func(*Message) int) (Matcher, error) {
+	toInt := func(s string) (int, error) { return strconv.Atoi(strings.TrimSpace(s)) }
+	switch op {
+	case cmpEq, cmpNeq, cmpLt, cmpLte, cmpGt, cmpGte:
+		want, err := toInt(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return intCmpMatcher(op, want, get), nil
+	case cmpIn:
+		wants := make([]int, 0, len(args))
+		for _, a := range args {
+			v, err := toInt(a)
+			if err != nil {
+				return nil, err
+			}
+			wants = append(wants, v)
+		}
+		return func(m *Message) bool {
+			v := get(m)
+			for _, want := range wants {
+				if v == want {
+					return true
+				}
+			}
+			return false
+		}, nil
+	default:
+		return nil, fmt.Errorf("operator not supported for this field")
+	}
+}
+
+func intCmpMatcher(op cmpOp, want int, get func(*Message) int) Matcher {
+	switch op {
+	case cmpEq:
+		return func(m *Message) bool { return get(m) == want }
+	case cmpNeq:
+		return func(m *Message) bool { return get(m) != want }
+	case cmpLt:
+		return func(m *Message) bool { return get(m) < want }
+	case cmpLte:
+		return func(m *Message) bool { return get(m) <= want }
+	case cmpGt:
+		return func(m *Message) bool { return get(m) > want }
+	case cmpGte:
+		return func(m *Message) bool { return get(m) >= want }
+	}
+	return func(m *Message) bool { return false }
+}
+
+func compileURNCmp(op cmpOp, args []string) (Matcher, error) {
+	switch op {
+	case cmpEq:
+		want := URN(args[0])
+		return func(m *Message) bool { return m.EventURN == want }, nil
+	case cmpNeq:
+		want := URN(args[0])
+		return func(m *Message) bool { return m.EventURN != want }, nil
+	case cmpIn:
+		wants := make([]URN, 0, len(args))
+		for _, a := range args {
+			wants = append(wants, URN(a))
+		}
+		return func(m *Message) bool {
+			for _, want := range wants {
+				if m.EventURN == want {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case cmpLike:
+		pattern := args[0]
+		return func(m *Message) bool { return globMatch(pattern, string(m.EventURN)) }, nil
+	default:
+		return nil, fmt.Errorf("operator not supported for event_urn")
+	}
+}
+
+// parseScopeLiteral maps the query-language scope literal to MessageScope.
+//
+// Unlike MessageScope.Parse (which decodes the two routing-key interest
+// segments) this matches the scope names consumers actually write in
+// queries.
+func parseScopeLiteral(s string) (MessageScope, error) {
+	switch strings.ToLower(s) {
+	case "live":
+		return MessageScopeLive, nil
+	case "prematch":
+		return MessageScopePrematch, nil
+	case "prematch_and_live", "prematch+live":
+		return MessageScopePrematchAndLive, nil
+	case "virtuals":
+		return MessageScopeVirtuals, nil
+	case "system":
+		return MessageScopeSystem, nil
+	default:
+		return 0, fmt.Errorf("unknown scope %q", s)
+	}
+}
+
+// parsePriorityLiteral maps the query-language priority literal ('hi'/'lo')
+// to MessagePriority.
+func parsePriorityLiteral(s string) (MessagePriority, error) {
+	switch strings.ToLower(s) {
+	case "hi":
+		return MessagePriorityHigh, nil
+	case "lo":
+		return MessagePriorityLow, nil
+	default:
+		return 0, fmt.Errorf("unknown priority %q", s)
+	}
+}
+
+// globMatch matches s against a pattern containing at most one "*" wildcard.
+func globMatch(pattern, s string) bool {
+	i := strings.IndexByte(pattern, '*')
+	if i < 0 {
+		return pattern == s
+	}
+	prefix, suffix := pattern[:i], pattern[i+1:]
+	return strings.HasPrefix(s, prefix) && strings.HasSuffix(s, suffix) && len(s) >= len(prefix)+len(suffix)
+}
+
+// tokenKind identifies the lexical class of a queryToken.
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+	tokEOF
+)
+
+type queryToken struct {
+	kind tokenKind
+	val  string
+}
+
+// tokenizeQuery splits expr into queryTokens. Identifiers are matched
+// case-insensitively against the AND/OR/NOT/IN/LIKE keywords; anything else
+// is returned as-is so field names keep their original case.
+func tokenizeQuery(expr string) []queryToken {
+	var toks []queryToken
+	r := []rune(expr)
+	i := 0
+	for i < len(r) {
+		c := r[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			toks = append(toks, queryToken{tokLParen, "("})
+			i++
+		case c == ')':
+			toks = append(toks, queryToken{tokRParen, ")"})
+			i++
+		case c == ',':
+			toks = append(toks, queryToken{tokComma, ","})
+			i++
+		case c == '\'' || c == '"':
+			quote := c
+			j := i + 1
+			for j < len(r) && r[j] != quote {
+				j++
+			}
+			toks = append(toks, queryToken{tokString, string(r[i+1 : j])})
+			i = j + 1
+		case c == '!' && i+1 < len(r) && r[i+1] == '=':
+			toks = append(toks, queryToken{tokOp, "!="})
+			i += 2
+		case c == '<' || c == '>':
+			if i+1 < len(r) && r[i+1] == '=' {
+				toks = append(toks, queryToken{tokOp, string(c) + "="})
+				i += 2
+			} else {
+				toks = append(toks, queryToken{tokOp, string(c)})
+				i++
+			}
+		case c == '=':
+			toks = append(toks, queryToken{tokOp, "="})
+			i++
+		default:
+			j := i
+			for j < len(r) && !strings.ContainsRune(" \t\n(),='\"!<>", r[j]) {
+				j++
+			}
+			toks = append(toks, queryToken{tokIdent, string(r[i:j])})
+			i = j
+		}
+	}
+	toks = append(toks, queryToken{tokEOF, ""})
+	return toks
+}
+
+// queryParser is a small recursive-descent parser over queryTokens.
+//
+// Precedence, loosest to tightest: OR, AND, NOT, comparison. This matches
+// the usual SQL-like reading of `a AND b OR c AND NOT d`.
+type queryParser struct {
+	toks []queryToken
+	pos  int
+}
+
+func (p *queryParser) peek() queryToken { return p.toks[p.pos] }
+func (p *queryParser) eof() bool        { return p.peek().kind == tokEOF }
+func (p *queryParser) next() queryToken {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *queryParser) keyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && strings.EqualFold(t.val, kw)
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.keyword("NOT") {
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{n: n}, nil
+	}
+	if p.peek().kind == tokLParen {
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		p.next()
+		return n, nil
+	}
+	return p.parseCmp()
+}
+
+func (p *queryParser) parseCmp() (queryNode, error) {
+	field := p.next()
+	if field.kind != tokIdent {
+		return nil, fmt.Errorf("expected field name, got %q", field.val)
+	}
+
+	if p.keyword("IN") {
+		p.next()
+		if p.peek().kind != tokLParen {
+			return nil, fmt.Errorf("expected '(' after IN")
+		}
+		p.next()
+		var args []string
+		for {
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, v)
+			if p.peek().kind == tokComma {
+				p.next()
+				continue
+			}
+			break
+		}
+		if p.peek().kind != tokRParen {
+			return nil, fmt.Errorf("missing closing parenthesis after IN list")
+		}
+		p.next()
+		return &cmpNode{field: strings.ToLower(field.val), op: cmpIn, args: args}, nil
+	}
+
+	if p.keyword("LIKE") {
+		p.next()
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return &cmpNode{field: strings.ToLower(field.val), op: cmpLike, args: []string{v}}, nil
+	}
+
+	opTok := p.next()
+	if opTok.kind != tokOp {
+		return nil, fmt.Errorf("expected operator after field %q, got %q", field.val, opTok.val)
+	}
+	op, err := parseCmpOp(opTok.val)
+	if err != nil {
+		return nil, err
+	}
+	v, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return &cmpNode{field: strings.ToLower(field.val), op: op, args: []string{v}}, nil
+}
+
+func (p *queryParser) parseValue() (string, error) {
+	t := p.next()
+	if t.kind != tokString && t.kind != tokIdent {
+		return "", fmt.Errorf("expected value, got %q", t.val)
+	}
+	return t.val, nil
+}
+
+func parseCmpOp(s string) (cmpOp, error) {
+	switch s {
+	case "=":
+		return cmpEq, nil
+	case "!=":
+		return cmpNeq, nil
+	case "<":
+		return cmpLt, nil
+	case "<=":
+		return cmpLte, nil
+	case ">":
+		return cmpGt, nil
+	case ">=":
+		return cmpGte, nil
+	default:
+		return 0, fmt.Errorf("unknown operator %q", s)
+	}
+}
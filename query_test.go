@@ -0,0 +1,107 @@
+package uof
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryMatch(t *testing.T) {
+	m := &Message{
+		Header: Header{
+			Type:     MessageTypeOddsChange,
+			Scope:    MessageScopeLive,
+			Priority: MessagePriorityHigh,
+			SportID:  1,
+			EventURN: "sr:match:1234",
+			EventID:  1234,
+		},
+	}
+
+	data := []struct {
+		expr  string
+		match bool
+	}{
+		{"type='odds_change'", true},
+		{"type='bet_settlement'", false},
+		{"type='odds_change' AND sport_id=1", true},
+		{"type='odds_change' AND sport_id=2", false},
+		{"type='odds_change' AND sport_id=1 AND scope IN ('live','prematch')", true},
+		{"scope IN ('prematch','virtuals')", false},
+		{"type='odds_change' AND sport_id=1 AND scope IN ('live','prematch') AND priority='hi'", true},
+		{"NOT type='odds_change'", false},
+		{"type='alive' OR sport_id=1", true},
+		{"type='alive' OR (sport_id=1 AND priority='lo')", false},
+		{"event_urn LIKE 'sr:match:*'", true},
+		{"event_urn LIKE 'vs:match:*'", false},
+		{"event_id>=1000 AND event_id<2000", true},
+		{"event_id>=2000", false},
+	}
+
+	for _, d := range data {
+		q, err := ParseQuery(d.expr)
+		assert.Nil(t, err, d.expr)
+		assert.Equal(t, d.match, q.Match(m), d.expr)
+	}
+}
+
+func TestQueryParseErrors(t *testing.T) {
+	data := []string{
+		"",
+		"sport_id",
+		"sport_id = ",
+		"sport_id = 1 AND",
+		"sport_id = 1)",
+		"(sport_id = 1",
+		"type='not_a_type'",
+		"scope='not_a_scope'",
+	}
+	for _, expr := range data {
+		_, err := ParseQuery(expr)
+		assert.NotNil(t, err, expr)
+	}
+}
+
+func TestQueryOperatorPrecedence(t *testing.T) {
+	m := &Message{Header: Header{SportID: 1, Priority: MessagePriorityLow}}
+	// AND binds tighter than OR: sport_id=2 OR (sport_id=1 AND priority='lo')
+	q, err := ParseQuery("sport_id=2 OR sport_id=1 AND priority='lo'")
+	assert.Nil(t, err)
+	assert.True(t, q.Match(m))
+
+	q, err = ParseQuery("sport_id=2 OR sport_id=1 AND priority='hi'")
+	assert.Nil(t, err)
+	assert.False(t, q.Match(m))
+}
+
+func BenchmarkQuerySubscribers(b *testing.B) {
+	m := &Message{
+		Header: Header{
+			Type:     MessageTypeOddsChange,
+			Scope:    MessageScopeLive,
+			Priority: MessagePriorityHigh,
+			SportID:  1,
+			EventURN: "sr:match:1234",
+		},
+	}
+	for _, n := range []int{10, 100, 1000} {
+		n := n
+		b.Run(fmt.Sprintf("subscribers-%d", n), func(b *testing.B) {
+			matchers := make([]Matcher, n)
+			for i := range matchers {
+				q, err := ParseQuery("type='odds_change' AND sport_id=1 AND scope IN ('live','prematch')")
+				if err != nil {
+					b.Fatal(err)
+				}
+				matchers[i] = q.Matcher()
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, match := range matchers {
+					match(m)
+				}
+			}
+		})
+	}
+}
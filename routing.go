@@ -0,0 +1,59 @@
+package uof
+
+import "strings"
+
+// RoutingFilter matches AMQP routing keys using glob patterns over the
+// seven dot-separated key segments (priority, prematch interest, live
+// interest, message type, sport, event URN prefix, event id), the same
+// layout Message.parseRoutingKey decodes. Each segment may be "*" to match
+// anything, or a literal to match exactly (including the "-" no-interest
+// placeholder Betradar sends). Fewer than seven segments pads the pattern
+// with trailing "*", so `"hi.*.live.odds_change.1"` matches any event URN
+// and id.
+//
+// Example: "hi.*.live.odds_change.1.sr:match.*" matches every live,
+// high-priority odds_change for sport 1 on any sr:match event.
+type RoutingFilter string
+
+const routingFilterSegments = 7
+
+// Match reports whether routingKey satisfies the filter.
+func (f RoutingFilter) Match(routingKey string) bool {
+	pattern := strings.Split(string(f), ".")
+	key := strings.Split(routingKey, ".")
+	for i := 0; i < routingFilterSegments; i++ {
+		p := segmentAt(pattern, i)
+		if p == "*" {
+			continue
+		}
+		if p != segmentAt(key, i) {
+			return false
+		}
+	}
+	return true
+}
+
+func segmentAt(parts []string, i int) string {
+	if i < len(parts) {
+		return parts[i]
+	}
+	return "*"
+}
+
+// RoutingFilters is a list of RoutingFilter matched with OR semantics: a
+// routing key is accepted if any filter in the list matches. An empty list
+// matches everything, mirroring the current catch-all binding.
+type RoutingFilters []RoutingFilter
+
+// MatchAny reports whether routingKey satisfies any filter in fs.
+func (fs RoutingFilters) MatchAny(routingKey string) bool {
+	if len(fs) == 0 {
+		return true
+	}
+	for _, f := range fs {
+		if f.Match(routingKey) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package uof
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoutingFilterMatch(t *testing.T) {
+	data := []struct {
+		filter RoutingFilter
+		key    string
+		match  bool
+	}{
+		{"hi.*.live.odds_change.1.sr:match.*", "hi.-.live.odds_change.1.sr:match.1234", true},
+		{"hi.*.live.odds_change.1.sr:match.*", "hi.-.live.odds_change.2.sr:match.1234", false},
+		{"hi.*.live.odds_change.1.sr:match.*", "lo.-.live.odds_change.1.sr:match.1234", false},
+		{"*.*.*.bet_settlement.*.*.*", "lo.pre.live.bet_settlement.8.sr:match.12", true},
+		{"-.-.-.alive.-.-.-", "-.-.-.alive.-.-.-.-", true},
+		{"hi.*.live.odds_change.1", "hi.-.live.odds_change.1.sr:match.1234", true},
+	}
+	for _, d := range data {
+		assert.Equal(t, d.match, d.filter.Match(d.key), "%s vs %s", d.filter, d.key)
+	}
+}
+
+func TestRoutingFiltersMatchAny(t *testing.T) {
+	fs := RoutingFilters{"*.*.*.odds_change.1.*.*", "*.*.*.bet_settlement.*.*.*"}
+	assert.True(t, fs.MatchAny("hi.-.live.odds_change.1.sr:match.1234"))
+	assert.True(t, fs.MatchAny("lo.pre.live.bet_settlement.8.sr:match.12"))
+	assert.False(t, fs.MatchAny("hi.-.live.bet_cancel.21.sr:match.13073610"))
+
+	var none RoutingFilters
+	assert.True(t, none.MatchAny("anything.goes.here.alive.-.-.-"))
+}
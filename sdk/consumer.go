@@ -0,0 +1,501 @@
+package sdk
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/minus5/go-uof-sdk"
+	"github.com/minus5/go-uof-sdk/pipe"
+)
+
+// OverflowPolicy decides what a Consumer does when its buffer is full and
+// a new message arrives.
+type OverflowPolicy int
+
+const (
+	// DropOldest discards the oldest buffered, not-yet-fetched message to
+	// make room for the new one.
+	DropOldest OverflowPolicy = iota
+	// DropNew discards the incoming message, keeping the buffer as is.
+	DropNew
+	// Block stops the pipe until a consumer Fetches and frees up room.
+	// Only use this if the consumer is guaranteed to keep up eventually;
+	// it otherwise backs up the whole pipe.
+	Block
+)
+
+// defaultBackOff is used when WithBackOff isn't given.
+var defaultBackOff = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, 2 * time.Minute}
+
+const defaultMaxDeliver = 5
+const defaultBufferSize = 1000
+const defaultSweepInterval = time.Second
+
+type consumerConfig struct {
+	bufferSize     int
+	overflow       OverflowPolicy
+	backOff        []time.Duration
+	maxDeliver     int
+	filterSubjects []string
+	cursorStore    CursorStore
+}
+
+// ConsumerOption configures a Consumer created by PullConsumer.
+type ConsumerOption func(*consumerConfig)
+
+// WithBufferSize sets how many not-yet-fetched messages the consumer holds
+// before overflow applies; fetched but unacked deliveries don't count
+// towards it. Defaults to 1000.
+func WithBufferSize(n int) ConsumerOption {
+	return func(c *consumerConfig) { c.bufferSize = n }
+}
+
+// WithOverflow sets the policy applied once the buffer is full. Defaults
+// to DropOldest.
+func WithOverflow(p OverflowPolicy) ConsumerOption {
+	return func(c *consumerConfig) { c.overflow = p }
+}
+
+// WithBackOff sets the redelivery delays applied after a Nak or a visibility
+// timeout, indexed by delivery attempt (the last entry is reused for every
+// attempt beyond len(d)). Defaults to 1s, 5s, 30s, 2m.
+func WithBackOff(d []time.Duration) ConsumerOption {
+	return func(c *consumerConfig) { c.backOff = d }
+}
+
+// WithMaxDeliver caps how many times a message is delivered, the first
+// delivery included, before it's dropped. Defaults to 5.
+func WithMaxDeliver(n int) ConsumerOption {
+	return func(c *consumerConfig) { c.maxDeliver = n }
+}
+
+// WithFilterSubjects narrows the consumer to messages matching any of the
+// given uof.ParseQuery expressions (an implicit OR across the list).
+func WithFilterSubjects(subjects []string) ConsumerOption {
+	return func(c *consumerConfig) { c.filterSubjects = subjects }
+}
+
+// WithCursorStore makes the consumer persist its ack cursor in store
+// instead of the default file-backed one.
+func WithCursorStore(store CursorStore) ConsumerOption {
+	return func(c *consumerConfig) { c.cursorStore = store }
+}
+
+// CursorStore persists the last acked position of a named Consumer so it
+// can resume after a restart instead of redelivering everything.
+type CursorStore interface {
+	// Load returns the last saved ReceivedAt for name, or 0 if there's none.
+	Load(name string) (int, error)
+	// Save persists receivedAt as the new cursor for name.
+	Save(name string, receivedAt int) error
+}
+
+// FileCursorStore persists cursors as one JSON file per consumer name under
+// dir.
+type FileCursorStore struct {
+	dir string
+}
+
+// NewFileCursorStore returns a FileCursorStore rooted at dir. dir must
+// already exist.
+func NewFileCursorStore(dir string) *FileCursorStore {
+	return &FileCursorStore{dir: dir}
+}
+
+type cursorFile struct {
+	ReceivedAt int `json:"receivedAt"`
+}
+
+func (s *FileCursorStore) path(name string) string {
+	return s.dir + "/" + name + ".cursor.json"
+}
+
+// Load implements CursorStore.
+func (s *FileCursorStore) Load(name string) (int, error) {
+	buf, err := os.ReadFile(s.path(name))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, uof.Notice("consumer.Load", err)
+	}
+	var cf cursorFile
+	if err := json.Unmarshal(buf, &cf); err != nil {
+		return 0, uof.Notice("consumer.Load", err)
+	}
+	return cf.ReceivedAt, nil
+}
+
+// Save implements CursorStore.
+func (s *FileCursorStore) Save(name string, receivedAt int) error {
+	buf, err := json.Marshal(cursorFile{ReceivedAt: receivedAt})
+	if err != nil {
+		return uof.Notice("consumer.Save", err)
+	}
+	if err := os.WriteFile(s.path(name), buf, 0600); err != nil {
+		return uof.Notice("consumer.Save", err)
+	}
+	return nil
+}
+
+// pendingMsg is one in-flight or queued message.
+type pendingMsg struct {
+	seq      uint64
+	msg      *uof.Message
+	tries    int
+	deadline time.Time
+	resolved bool // Acked, or dropped after MaxDeliver
+}
+
+// Delivery wraps one message handed out by Consumer.Fetch. The caller must
+// Ack, Nak or InProgress it; an unacked Delivery is redelivered once its
+// visibility deadline passes.
+type Delivery struct {
+	Message *uof.Message
+
+	c   *Consumer
+	seq uint64
+}
+
+// Ack confirms successful processing. The durable cursor only advances past
+// a contiguous prefix of resolved deliveries, so Acking out of order within
+// a batch is safe: an earlier, still-outstanding Delivery keeps the cursor
+// from passing it until it too is Acked or redelivery gives up on it.
+func (d *Delivery) Ack() error {
+	return d.c.ack(d.seq)
+}
+
+// Nak signals failed processing; the message is redelivered after the next
+// BackOff delay, or dropped once MaxDeliver is reached.
+func (d *Delivery) Nak() error {
+	return d.c.nak(d.seq)
+}
+
+// InProgress extends the visibility deadline without counting as a failed
+// attempt. Call it periodically while still working a message that takes
+// longer than the configured BackOff.
+func (d *Delivery) InProgress() error {
+	return d.c.touch(d.seq)
+}
+
+// Consumer is a pull/ack-based view over the pipe: Fetch pulls a batch,
+// Ack/Nak/InProgress report back on it. Unlike sdk.Callback, a slow or
+// failing consumer never tears down the rest of the pipe - messages queue
+// up (subject to Overflow) and unacked ones are redelivered.
+type Consumer struct {
+	name string
+	cfg  consumerConfig
+
+	mu       sync.Mutex
+	roomCond *sync.Cond // signaled when queue shrinks, for Block overflow
+	queue    *list.List // of *pendingMsg, ready for Fetch
+	inFlight map[uint64]*pendingMsg
+	order    *list.List // of *pendingMsg, dispatch order, pruned as resolved
+	nextSeq  uint64
+	cursor   int
+	signal   chan struct{}
+	closed   bool
+	matcher  uof.Matcher
+}
+
+// PullConsumer creates a pull-mode consumer named name and the Option that
+// wires it into sdk.Run. name identifies its durable cursor on disk, so it
+// must be stable across restarts and unique per consumer.
+func PullConsumer(name string, opts ...ConsumerOption) (*Consumer, Option) {
+	cfg := consumerConfig{
+		bufferSize: defaultBufferSize,
+		overflow:   DropOldest,
+		backOff:    defaultBackOff,
+		maxDeliver: defaultMaxDeliver,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	if cfg.cursorStore == nil {
+		cfg.cursorStore = NewFileCursorStore(os.TempDir())
+	}
+
+	c := &Consumer{
+		name:     name,
+		cfg:      cfg,
+		queue:    list.New(),
+		inFlight: make(map[uint64]*pendingMsg),
+		order:    list.New(),
+		signal:   make(chan struct{}, 1),
+	}
+	c.roomCond = sync.NewCond(&c.mu)
+	if len(cfg.filterSubjects) > 0 {
+		c.matcher = orMatcher(cfg.filterSubjects)
+	}
+	if cursor, err := cfg.cursorStore.Load(name); err == nil {
+		c.cursor = cursor
+	}
+	go c.sweep()
+
+	stage := pipe.Simple(func(m *uof.Message) error {
+		c.enqueue(m)
+		return nil
+	})
+	return c, func(conf *Config) { conf.Stages = append(conf.Stages, stage) }
+}
+
+// orMatcher compiles subjects (uof.ParseQuery expressions) into a single
+// Matcher that reports true if any of them match. Expressions that fail to
+// parse are dropped; a consumer with no valid subject matches everything.
+func orMatcher(subjects []string) uof.Matcher {
+	var queries []*uof.Query
+	for _, s := range subjects {
+		q, err := uof.ParseQuery(s)
+		if err != nil {
+			continue
+		}
+		queries = append(queries, q)
+	}
+	if len(queries) == 0 {
+		return nil
+	}
+	return func(m *uof.Message) bool {
+		for _, q := range queries {
+			if q.Match(m) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (c *Consumer) enqueue(m *uof.Message) {
+	if c.matcher != nil && !c.matcher(m) {
+		return
+	}
+	if m.ReceivedAt <= c.cursorSnapshot() {
+		return // already acked before a restart
+	}
+
+	c.mu.Lock()
+	for c.cfg.overflow == Block && c.queue.Len() >= c.cfg.bufferSize && !c.closed {
+		// pipe.Simple calls this synchronously per message, so blocking
+		// here blocks the whole pipe until Fetch drains room - exactly
+		// the backpressure Block promises.
+		c.roomCond.Wait()
+	}
+	var evicted bool
+	if c.queue.Len() >= c.cfg.bufferSize {
+		switch c.cfg.overflow {
+		case DropOldest:
+			// Also resolve the evicted entry in order, not just c.queue -
+			// otherwise it (and everything behind it, since advanceCursor
+			// only drops a contiguous resolved prefix) would block the
+			// cursor from ever advancing past it again.
+			front := c.queue.Remove(c.queue.Front()).(*pendingMsg)
+			c.resolve(front)
+			evicted = true
+		case DropNew:
+			c.mu.Unlock()
+			return
+		}
+	}
+	c.nextSeq++
+	p := &pendingMsg{seq: c.nextSeq, msg: m}
+	c.queue.PushBack(p)
+	c.order.PushBack(p)
+	select {
+	case c.signal <- struct{}{}:
+	default:
+	}
+	cursor := c.cursor
+	c.mu.Unlock()
+	if evicted {
+		c.saveCursor(cursor)
+	}
+}
+
+// resolve marks p done (Acked or dead-lettered) and advances the cursor past
+// the contiguous resolved prefix of order. Caller must hold c.mu.
+func (c *Consumer) resolve(p *pendingMsg) {
+	p.resolved = true
+	c.advanceCursor()
+}
+
+// advanceCursor moves the cursor past the leading run of resolved entries in
+// order, dropping them once they're covered. Caller must hold c.mu.
+func (c *Consumer) advanceCursor() {
+	for c.order.Len() > 0 {
+		front := c.order.Front()
+		p := front.Value.(*pendingMsg)
+		if !p.resolved {
+			break
+		}
+		if p.msg.ReceivedAt > c.cursor {
+			c.cursor = p.msg.ReceivedAt
+		}
+		c.order.Remove(front)
+	}
+}
+
+// saveCursor persists cursor to the configured CursorStore, logging nothing
+// on failure: callers that aren't already returning an error to their own
+// caller (enqueue, sweep) have nowhere to report one either, and the next
+// successful Ack/dead-letter will retry the same save.
+func (c *Consumer) saveCursor(cursor int) {
+	c.cfg.cursorStore.Save(c.name, cursor)
+}
+
+func (c *Consumer) cursorSnapshot() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cursor
+}
+
+// Fetch returns up to batch deliveries, blocking until at least one is
+// available or ctx is done.
+func (c *Consumer) Fetch(ctx context.Context, batch int) ([]*Delivery, error) {
+	for {
+		c.mu.Lock()
+		var out []*Delivery
+		for c.queue.Len() > 0 && len(out) < batch {
+			e := c.queue.Front()
+			c.queue.Remove(e)
+			p := e.Value.(*pendingMsg)
+			p.tries++
+			p.deadline = time.Now().Add(c.backOffFor(p.tries))
+			c.inFlight[p.seq] = p
+			out = append(out, &Delivery{Message: p.msg, c: c, seq: p.seq})
+		}
+		if len(out) > 0 {
+			c.roomCond.Broadcast()
+		}
+		c.mu.Unlock()
+		if len(out) > 0 {
+			return out, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.signal:
+		}
+	}
+}
+
+func (c *Consumer) backOffFor(tries int) time.Duration {
+	i := tries - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(c.cfg.backOff) {
+		i = len(c.cfg.backOff) - 1
+	}
+	return c.cfg.backOff[i]
+}
+
+// ack marks seq resolved and saves the cursor once it's advanced past it.
+// The cursor only moves past a contiguous resolved prefix (see
+// advanceCursor), so it's safe to ack deliveries from the same Fetch batch
+// in any order.
+func (c *Consumer) ack(seq uint64) error {
+	c.mu.Lock()
+	p, ok := c.inFlight[seq]
+	if !ok {
+		c.mu.Unlock()
+		return fmt.Errorf("consumer %s: unknown delivery", c.name)
+	}
+	delete(c.inFlight, seq)
+	c.resolve(p)
+	cursor := c.cursor
+	c.mu.Unlock()
+	return c.cfg.cursorStore.Save(c.name, cursor)
+}
+
+// nak schedules p for redelivery after the next BackOff delay. It leaves p
+// in inFlight rather than pushing it straight back onto the ready queue -
+// sweep() is what moves an inFlight message to the ready queue, and it only
+// does that once p.deadline has passed, so this is what makes BackOff
+// actually delay redelivery instead of making it instant.
+func (c *Consumer) nak(seq uint64) error {
+	c.mu.Lock()
+	p, ok := c.inFlight[seq]
+	if !ok {
+		c.mu.Unlock()
+		return fmt.Errorf("consumer %s: unknown delivery", c.name)
+	}
+	if p.tries >= c.cfg.maxDeliver {
+		delete(c.inFlight, seq)
+		c.resolve(p) // dead-lettered: dropped, matches MaxDeliver contract
+		cursor := c.cursor
+		c.mu.Unlock()
+		c.saveCursor(cursor)
+		return nil
+	}
+	p.deadline = time.Now().Add(c.backOffFor(p.tries))
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Consumer) touch(seq uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.inFlight[seq]
+	if !ok {
+		return fmt.Errorf("consumer %s: unknown delivery", c.name)
+	}
+	p.deadline = time.Now().Add(c.backOffFor(p.tries))
+	return nil
+}
+
+// sweep redelivers in-flight messages whose deadline passed without an Ack:
+// the visibility deadline set by Fetch or InProgress, or the BackOff delay
+// set by Nak.
+func (c *Consumer) sweep() {
+	ticker := time.NewTicker(defaultSweepInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return
+		}
+		now := time.Now()
+		var expired []*pendingMsg
+		for seq, p := range c.inFlight {
+			if now.After(p.deadline) {
+				expired = append(expired, p)
+				delete(c.inFlight, seq)
+			}
+		}
+		deadLettered := false
+		for _, p := range expired {
+			if p.tries >= c.cfg.maxDeliver {
+				c.resolve(p) // dead-lettered
+				deadLettered = true
+				continue
+			}
+			c.queue.PushBack(p)
+		}
+		if len(expired) > 0 {
+			select {
+			case c.signal <- struct{}{}:
+			default:
+			}
+		}
+		cursor := c.cursor
+		c.mu.Unlock()
+		if deadLettered {
+			c.saveCursor(cursor)
+		}
+	}
+}
+
+// Close stops redelivery bookkeeping. Already-fetched Deliveries can still
+// be Acked or Naked after Close.
+func (c *Consumer) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.roomCond.Broadcast()
+	return nil
+}
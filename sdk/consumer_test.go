@@ -0,0 +1,199 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minus5/go-uof-sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+// memCursorStore is an in-memory CursorStore for tests, avoiding disk I/O
+// and cross-test collisions in os.TempDir.
+type memCursorStore struct {
+	mu sync.Mutex
+	m  map[string]int
+}
+
+func newMemCursorStore() *memCursorStore {
+	return &memCursorStore{m: make(map[string]int)}
+}
+
+func (s *memCursorStore) Load(name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m[name], nil
+}
+
+func (s *memCursorStore) Save(name string, receivedAt int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[name] = receivedAt
+	return nil
+}
+
+func testMessage(t *testing.T, eventID int) *uof.Message {
+	t.Helper()
+	key := fmt.Sprintf("hi.-.live.odds_change.1.sr:match.%d", eventID)
+	m, err := uof.NewQueueMessage(key, nil)
+	assert.Nil(t, err)
+	return m
+}
+
+func TestConsumerAckAdvancesCursor(t *testing.T) {
+	store := newMemCursorStore()
+	c, _ := PullConsumer("ack-test", WithCursorStore(store))
+	m := testMessage(t, 1)
+	c.enqueue(m)
+
+	ds, err := c.Fetch(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.Len(t, ds, 1)
+	assert.Nil(t, ds[0].Ack())
+
+	got, err := store.Load("ack-test")
+	assert.Nil(t, err)
+	assert.Equal(t, m.ReceivedAt, got)
+}
+
+func TestConsumerAckOutOfOrderDoesNotDropCursor(t *testing.T) {
+	store := newMemCursorStore()
+	c, _ := PullConsumer("ack-order-test", WithCursorStore(store))
+	m1, m2 := testMessage(t, 1), testMessage(t, 2)
+	c.enqueue(m1)
+	c.enqueue(m2)
+
+	ds, err := c.Fetch(context.Background(), 2)
+	assert.Nil(t, err)
+	assert.Len(t, ds, 2)
+
+	// Ack the second delivery while the first is still outstanding: the
+	// cursor must not jump past the first one's ReceivedAt.
+	assert.Nil(t, ds[1].Ack())
+	got, err := store.Load("ack-order-test")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, got)
+
+	// Acking the first delivery now resolves the contiguous prefix, so the
+	// cursor advances to the second (later) message's ReceivedAt.
+	assert.Nil(t, ds[0].Ack())
+	got, err = store.Load("ack-order-test")
+	assert.Nil(t, err)
+	assert.Equal(t, m2.ReceivedAt, got)
+}
+
+func TestConsumerNakRespectsBackOff(t *testing.T) {
+	c, _ := PullConsumer("nak-backoff-test",
+		WithCursorStore(newMemCursorStore()),
+		WithBackOff([]time.Duration{50 * time.Millisecond}))
+	c.enqueue(testMessage(t, 1))
+
+	ds, err := c.Fetch(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.Len(t, ds, 1)
+	assert.Nil(t, ds[0].Nak())
+
+	// Immediately after Nak, the message must not be redelivered yet: it's
+	// waiting out its BackOff delay, not sitting in the ready queue.
+	shortCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = c.Fetch(shortCtx, 1)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// Once the BackOff delay has passed and sweep() has had a chance to
+	// run, it's redelivered.
+	time.Sleep(defaultSweepInterval + 200*time.Millisecond)
+	ds2, err := c.Fetch(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.Len(t, ds2, 1)
+}
+
+func TestConsumerNakPersistsCursorOnDeadLetter(t *testing.T) {
+	store := newMemCursorStore()
+	c, _ := PullConsumer("dead-letter-test",
+		WithCursorStore(store), WithMaxDeliver(1))
+	m := testMessage(t, 1)
+	c.enqueue(m)
+
+	ds, err := c.Fetch(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.Len(t, ds, 1)
+	assert.Nil(t, ds[0].Nak())
+
+	// tries already reached MaxDeliver, so Nak dead-letters it immediately
+	// and the advanced cursor must be persisted, not just held in memory.
+	got, err := store.Load("dead-letter-test")
+	assert.Nil(t, err)
+	assert.Equal(t, m.ReceivedAt, got)
+}
+
+func TestConsumerOverflowDropOldest(t *testing.T) {
+	store := newMemCursorStore()
+	c, _ := PullConsumer("drop-oldest-test",
+		WithCursorStore(store),
+		WithBufferSize(2), WithOverflow(DropOldest))
+	for i := 1; i <= 3; i++ {
+		c.enqueue(testMessage(t, i))
+	}
+
+	ds, err := c.Fetch(context.Background(), 10)
+	assert.Nil(t, err)
+	assert.Len(t, ds, 2)
+	assert.Equal(t, 2, ds[0].Message.EventID)
+	assert.Equal(t, 3, ds[1].Message.EventID)
+
+	// The message DropOldest evicted before Fetch ever saw it must not
+	// block the cursor from advancing once the two survivors are acked.
+	assert.Nil(t, ds[0].Ack())
+	assert.Nil(t, ds[1].Ack())
+	got, err := store.Load("drop-oldest-test")
+	assert.Nil(t, err)
+	assert.Equal(t, ds[1].Message.ReceivedAt, got)
+}
+
+func TestConsumerOverflowDropNew(t *testing.T) {
+	c, _ := PullConsumer("drop-new-test",
+		WithCursorStore(newMemCursorStore()),
+		WithBufferSize(2), WithOverflow(DropNew))
+	for i := 1; i <= 3; i++ {
+		c.enqueue(testMessage(t, i))
+	}
+
+	ds, err := c.Fetch(context.Background(), 10)
+	assert.Nil(t, err)
+	assert.Len(t, ds, 2)
+	assert.Equal(t, 1, ds[0].Message.EventID)
+	assert.Equal(t, 2, ds[1].Message.EventID)
+}
+
+func TestConsumerOverflowBlock(t *testing.T) {
+	c, _ := PullConsumer("block-test",
+		WithCursorStore(newMemCursorStore()),
+		WithBufferSize(1), WithOverflow(Block))
+	c.enqueue(testMessage(t, 1))
+
+	done := make(chan struct{})
+	go func() {
+		c.enqueue(testMessage(t, 2)) // must block until Fetch frees room
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("enqueue with Block overflow returned before any room was freed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ds, err := c.Fetch(context.Background(), 1)
+	assert.Nil(t, err)
+	assert.Len(t, ds, 1)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("enqueue with Block overflow never unblocked after Fetch freed room")
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/minus5/go-uof-sdk"
 	"github.com/minus5/go-uof-sdk/api"
+	"github.com/minus5/go-uof-sdk/history"
 	"github.com/minus5/go-uof-sdk/pipe"
 	"github.com/minus5/go-uof-sdk/queue"
 )
@@ -13,14 +14,53 @@ import (
 var defaultLanuages = uof.Languages("en,de")
 
 type Config struct {
-	BookmakerID string
-	Token       string
-	Staging     bool
-	Languages   []uof.Lang
-	Fixtures    time.Time
-	Recovery    []uof.ProducerChange
-	Stages      []pipe.StageHandler
-	Replay      func(*api.ReplayApi) error
+	BookmakerID   string
+	Token         string
+	Staging       bool
+	Languages     []uof.Lang
+	Fixtures      time.Time
+	Recovery      []uof.ProducerChange
+	Stages        []pipe.StageHandler
+	Replay        func(*api.ReplayApi) error
+	History       history.Store
+	queryMatchers []uof.Matcher
+	needsFullBody bool
+	recovery      *recoveryGate
+	err           error
+}
+
+// recoveryGate holds the state RecoveryFromHistory needs to check each
+// Recovery entry against a history.Store before Run decides whether it
+// goes to the Betradar API or is replayed from disk.
+type recoveryGate struct {
+	store  history.Store
+	window func(uof.ProducerChange) (producer int, after time.Time)
+}
+
+// wantBody reports whether a consumer actually needs the XML body decoded
+// for a message with the given Header - nil means "always decode". It's the
+// Header-only predicate that would let queue.WithReconnect skip
+// xml.Unmarshal for messages every registered CallbackWhere query rejects,
+// once that package grows the parameter to accept it; see the TODO in Run.
+//
+// Returns nil whenever Callback or Pipe is registered, since those run
+// arbitrary caller code that can read any Body field. With only
+// CallbackWhere queries registered, a message is worth decoding if any one
+// of them would let it through.
+func (c *Config) wantBody() func(*uof.Header) bool {
+	if c.needsFullBody || len(c.queryMatchers) == 0 {
+		return nil
+	}
+	matchers := c.queryMatchers
+	return func(h *uof.Header) bool {
+		m := &uof.Message{Header: *h}
+		for _, match := range matchers {
+			if match(m) {
+				return true
+			}
+		}
+		return false
+	}
 }
 
 // Option sets attributes on the Config.
@@ -33,6 +73,9 @@ type Option func(*Config)
 // Credentials and one of Callback or Pipe are functional minimum.
 func Run(ctx context.Context, options ...Option) error {
 	c := config(options...)
+	if c.err != nil {
+		return c.err
+	}
 	qc, apiConn, err := connect(ctx, c)
 	if err != nil {
 		return err
@@ -53,11 +96,38 @@ func Run(ctx context.Context, options ...Option) error {
 		pipe.Player(apiConn, c.Languages),
 		pipe.BetStop(),
 	}
-	if len(c.Recovery) > 0 {
-		stages = append(stages, pipe.Recovery(apiConn, c.Recovery))
+
+	recovery := c.Recovery
+	if c.recovery != nil {
+		var fromAPI, fromDisk []uof.ProducerChange
+		for _, pc := range recovery {
+			producer, after := c.recovery.window(pc)
+			covered, err := c.recovery.store.Covers(producer, after, time.Now())
+			if err != nil {
+				return err
+			}
+			if covered {
+				fromDisk = append(fromDisk, pc)
+			} else {
+				fromAPI = append(fromAPI, pc)
+			}
+		}
+		if len(fromDisk) > 0 {
+			stages = append(stages, historyRecoveryStage(c.recovery.store, fromDisk, c.recovery.window))
+		}
+		recovery = fromAPI
+	}
+	if len(recovery) > 0 {
+		stages = append(stages, pipe.Recovery(apiConn, recovery))
 	}
 	stages = append(stages, c.Stages...)
 
+	// TODO: queue.WithReconnect in this tree only takes (ctx, qc); it
+	// doesn't yet accept a lazy-decode predicate, so wantBody isn't wired
+	// into message construction here. Thread it through once
+	// queue.WithReconnect grows that parameter - and only then reintroduce
+	// a RoutingFilters-based Filters Option, so it isn't shipped as a
+	// public no-op in the meantime.
 	errc := pipe.Build(
 		queue.WithReconnect(ctx, qc),
 		stages...,
@@ -65,6 +135,32 @@ func Run(ctx context.Context, options ...Option) error {
 	return firstErr(errc)
 }
 
+// historyRecoveryStage replays entries from store instead of the Betradar
+// recovery API - Run only builds this stage for entries store.Covers has
+// already confirmed are fully on disk. Each entry finishes with a
+// synthetic SnapshotComplete, the same end-of-recovery signal a real
+// Betradar recovery run sends, before the stage falls through to
+// forwarding every later live message unchanged.
+func historyRecoveryStage(store history.Store, entries []uof.ProducerChange, window func(uof.ProducerChange) (int, time.Time)) pipe.StageHandler {
+	return func(in <-chan *uof.Message, out chan<- *uof.Message, errc chan<- error) {
+		for _, pc := range entries {
+			producer, after := window(pc)
+			msgs, err := store.Recovery(producer, after, time.Now())
+			if err != nil {
+				errc <- err
+				continue
+			}
+			for _, m := range msgs {
+				out <- m
+			}
+			out <- uof.NewSnapshotCompleteMessage()
+		}
+		for m := range in {
+			out <- m
+		}
+	}
+}
+
 func firstErr(errc <-chan error) error {
 	var err error
 	for e := range errc {
@@ -159,23 +255,96 @@ func Replay(cb func(*api.ReplayApi) error) Option {
 }
 
 // Pipe sets chan handler for all messages.
-// Can be called multiple times.
+//
+// s runs arbitrary caller code against the full Message, so it forces
+// every message's XML body to be decoded eagerly - see wantBody. Can be
+// called multiple times.
 func Pipe(s pipe.StageHandler) Option {
 	return func(c *Config) {
+		c.needsFullBody = true
 		c.Stages = append(c.Stages, s)
 	}
 }
 
 // Callback sets handler for all messages.
 //
-// If returns error will break the pipe and force exit from sdk.Run.
-// Can be called multiple times.
+// If returns error will break the pipe and force exit from sdk.Run. cb can
+// read any Body field, so it forces every message's XML body to be decoded
+// eagerly - see wantBody. Can be called multiple times.
 func Callback(cb func(m *uof.Message) error) Option {
 	return func(c *Config) {
+		c.needsFullBody = true
 		c.Stages = append(c.Stages, pipe.Simple(cb))
 	}
 }
 
+// CallbackWhere sets handler for messages matching query.
+//
+// query uses the filter expression language of uof.ParseQuery, e.g.
+// `type='odds_change' AND sport_id=1 AND scope IN ('live','prematch')`. Only
+// messages whose Header satisfies it reach cb; everything else is passed
+// through unchanged without calling cb. If cb returns error will break the
+// pipe and force exit from sdk.Run. Can be called multiple times.
+//
+// Unlike Callback/Pipe, query only ever looks at Header - see wantBody,
+// which lets Run skip decoding the XML body of messages every registered
+// CallbackWhere query would drop, once that's wired into queue.WithReconnect.
+func CallbackWhere(query string, cb func(m *uof.Message) error) Option {
+	return func(c *Config) {
+		q, err := uof.ParseQuery(query)
+		if err != nil {
+			c.err = err
+			return
+		}
+		match := q.Matcher()
+		c.queryMatchers = append(c.queryMatchers, match)
+		c.Stages = append(c.Stages, whereStage(match, cb))
+	}
+}
+
+// whereStage runs cb only for messages match accepts, forwarding every
+// message downstream unchanged either way, stopping (like pipe.Simple) the
+// first time cb returns an error.
+func whereStage(match uof.Matcher, cb func(m *uof.Message) error) pipe.StageHandler {
+	return func(in <-chan *uof.Message, out chan<- *uof.Message, errc chan<- error) {
+		for m := range in {
+			if match(m) {
+				if err := cb(m); err != nil {
+					errc <- err
+					return
+				}
+			}
+			out <- m
+		}
+	}
+}
+
+// History durably records every consumed message to store, indexed by the
+// producer it came from, so operators can later re-drive downstream
+// consumers after a crash (store.Recovery) or inspect a given event
+// (store.Between) without re-running recovery.
+//
+// producer resolves the Betradar producer ID for a message; Header carries
+// none, so callers that know their producer mix must supply it. Passing nil
+// calls store.Put with producer 0, which leaves messages out of the
+// per-producer index, so store.Recovery/store.Covers can't answer a real
+// per-producer query, though store.Between still works.
+//
+// See RecoveryFromHistory to also have Run skip the Betradar recovery API
+// for a window store already covers.
+func History(store history.Store, producer func(*uof.Message) int) Option {
+	return func(c *Config) {
+		c.History = store
+		c.Stages = append(c.Stages, pipe.Simple(func(m *uof.Message) error {
+			p := 0
+			if producer != nil {
+				p = producer(m)
+			}
+			return store.Put(p, m)
+		}))
+	}
+}
+
 // Recovery starts recovery for each producer
 //
 // It is responsibility of SDK consumer to track the last timestamp of the
@@ -189,6 +358,23 @@ func Recovery(pc []uof.ProducerChange) Option {
 	}
 }
 
+// RecoveryFromHistory gates the Recovery option against store: for every
+// entry whose window store.Covers reports as fully recorded on disk, Run
+// replays it from store.Recovery instead of calling the Betradar recovery
+// API, finishing with a synthetic SnapshotComplete the same way a real
+// recovery run would. Entries store doesn't cover still go through
+// pipe.Recovery as before.
+//
+// window resolves the Betradar producer ID and recovery-start time a
+// uof.ProducerChange entry is asking for, the same gap History's producer
+// parameter works around - the caller that built the Recovery list already
+// knows this shape and must supply it.
+func RecoveryFromHistory(store history.Store, window func(uof.ProducerChange) (producer int, after time.Time)) Option {
+	return func(c *Config) {
+		c.recovery = &recoveryGate{store: store, window: window}
+	}
+}
+
 // Fixtures gets pre-match fixtures at start-up.
 //
 // It gets fixture for all matches which starts before `to` time.
@@ -201,4 +387,4 @@ func Fixtures(to time.Time) Option {
 	return func(c *Config) {
 		c.Fixtures = to
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,102 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/minus5/go-uof-sdk"
+	"github.com/minus5/go-uof-sdk/history"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigWantBodyNilWithNoCallbackWhere(t *testing.T) {
+	c := config(Callback(func(*uof.Message) error { return nil }))
+	assert.Nil(t, c.wantBody())
+}
+
+func TestConfigWantBodyNilWhenCallbackAlsoRegistered(t *testing.T) {
+	c := config(
+		CallbackWhere("type='odds_change'", func(*uof.Message) error { return nil }),
+		Callback(func(*uof.Message) error { return nil }),
+	)
+	assert.Nil(t, c.wantBody())
+}
+
+func TestConfigWantBodyMatchesAnyRegisteredQuery(t *testing.T) {
+	c := config(
+		CallbackWhere("type='odds_change'", func(*uof.Message) error { return nil }),
+		CallbackWhere("type='bet_stop'", func(*uof.Message) error { return nil }),
+	)
+	wantBody := c.wantBody()
+	assert.NotNil(t, wantBody)
+	assert.True(t, wantBody(&uof.Header{Type: uof.MessageTypeOddsChange}))
+	assert.True(t, wantBody(&uof.Header{Type: uof.MessageTypeBetStop}))
+	assert.False(t, wantBody(&uof.Header{Type: uof.MessageTypeAlive}))
+}
+
+func TestWhereStageCallsCbOnlyForMatchesAndForwardsAll(t *testing.T) {
+	match := func(m *uof.Message) bool { return m.Type == uof.MessageTypeOddsChange }
+	var got []*uof.Message
+	stage := whereStage(match, func(m *uof.Message) error {
+		got = append(got, m)
+		return nil
+	})
+
+	in := make(chan *uof.Message, 2)
+	out := make(chan *uof.Message, 2)
+	errc := make(chan error, 1)
+
+	oddsChange := &uof.Message{Header: uof.Header{Type: uof.MessageTypeOddsChange}}
+	betStop := &uof.Message{Header: uof.Header{Type: uof.MessageTypeBetStop}}
+	in <- oddsChange
+	in <- betStop
+	close(in)
+
+	stage(in, out, errc)
+	close(out)
+
+	var forwarded []*uof.Message
+	for m := range out {
+		forwarded = append(forwarded, m)
+	}
+	assert.Equal(t, []*uof.Message{oddsChange}, got)
+	assert.Equal(t, []*uof.Message{oddsChange, betStop}, forwarded)
+}
+
+// fakeHistoryStore is a minimal history.Store for exercising
+// historyRecoveryStage without a real BoltDB file.
+type fakeHistoryStore struct {
+	history.Store
+	recovered []*uof.Message
+}
+
+func (s *fakeHistoryStore) Recovery(producer int, from, to time.Time) ([]*uof.Message, error) {
+	return s.recovered, nil
+}
+
+func TestHistoryRecoveryStageReplaysThenForwardsLive(t *testing.T) {
+	stored := &uof.Message{Header: uof.Header{Type: uof.MessageTypeOddsChange, EventID: 1, ReceivedAt: 100}}
+	store := &fakeHistoryStore{recovered: []*uof.Message{stored}}
+	window := func(uof.ProducerChange) (int, time.Time) { return 7, time.UnixMilli(0) }
+	stage := historyRecoveryStage(store, []uof.ProducerChange{{}}, window)
+
+	in := make(chan *uof.Message, 1)
+	out := make(chan *uof.Message, 10)
+	errc := make(chan error, 1)
+
+	live := testMessage(t, 99)
+	in <- live
+	close(in)
+
+	stage(in, out, errc)
+	close(out)
+
+	var got []*uof.Message
+	for m := range out {
+		got = append(got, m)
+	}
+	assert.Len(t, got, 3)
+	assert.Same(t, stored, got[0])
+	assert.Equal(t, uof.MessageTypeSnapshotComplete, got[1].Type)
+	assert.Same(t, live, got[2])
+}